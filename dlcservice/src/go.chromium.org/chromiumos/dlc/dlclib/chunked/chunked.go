@@ -0,0 +1,242 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package chunked implements lazy, on-demand extraction of DLC images that
+// carry a zstd-chunked style table of contents (modeled on zstd-chunked /
+// estargz), so callers can pull out a handful of files without paying the
+// cost of decompressing the whole image.
+package chunked
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	footerSize  = 40
+	footerMagic = "DLCCHNK1"
+)
+
+// ErrNoFooter is returned by Open when imagePath has no chunked footer, so
+// callers can fall back to a full-image extractor.
+var ErrNoFooter = errors.New("chunked: image has no chunked footer")
+
+// FileEntry describes one file packed into a chunked DLC image. Each file
+// occupies its own independently decodable zstd frame so it can be
+// decompressed without touching the rest of the image.
+type FileEntry struct {
+	Name        string `json:"name"`
+	Mode        uint32 `json:"mode"`
+	Size        int64  `json:"size"`
+	UID         int    `json:"uid"`
+	GID         int    `json:"gid"`
+	StartOffset int64  `json:"startOffset"`
+	EndOffset   int64  `json:"endOffset"`
+	Digest      string `json:"digest"`
+}
+
+// TOC is the sidecar table of contents packed into a chunked DLC image.
+type TOC struct {
+	Files []FileEntry `json:"files"`
+}
+
+// footer is the fixed 40-byte little-endian trailer that points at the TOC.
+type footer struct {
+	Magic     [8]byte
+	TOCOffset uint64
+	TOCLength uint64
+	TOCDigest [8]byte
+	_         uint64 // reserved
+}
+
+// Image is a chunked DLC image opened for lazy extraction.
+type Image struct {
+	path   string
+	toc    TOC
+	byName map[string]*FileEntry
+}
+
+// Open reads imagePath's footer and TOC, verifying the TOC against its
+// digest. It returns ErrNoFooter if imagePath has no chunked footer, so
+// callers can fall back to a full-image extractor.
+func Open(imagePath string) (*Image, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("chunked.Open: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("chunked.Open: %w", err)
+	}
+	if info.Size() < footerSize {
+		return nil, ErrNoFooter
+	}
+
+	buf := make([]byte, footerSize)
+	if _, err := f.ReadAt(buf, info.Size()-footerSize); err != nil {
+		return nil, fmt.Errorf("chunked.Open: failed to read footer: %w", err)
+	}
+
+	var ft footer
+	if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, &ft); err != nil {
+		return nil, fmt.Errorf("chunked.Open: failed to decode footer: %w", err)
+	}
+	if string(ft.Magic[:]) != footerMagic {
+		return nil, ErrNoFooter
+	}
+
+	tocBytes := make([]byte, ft.TOCLength)
+	if _, err := f.ReadAt(tocBytes, int64(ft.TOCOffset)); err != nil {
+		return nil, fmt.Errorf("chunked.Open: failed to read TOC: %w", err)
+	}
+
+	sum := sha256.Sum256(tocBytes)
+	if !bytes.Equal(sum[:8], ft.TOCDigest[:]) {
+		return nil, fmt.Errorf("chunked.Open: TOC digest mismatch for %s", imagePath)
+	}
+
+	var toc TOC
+	if err := json.Unmarshal(tocBytes, &toc); err != nil {
+		return nil, fmt.Errorf("chunked.Open: failed to unmarshal TOC: %w", err)
+	}
+
+	byName := make(map[string]*FileEntry, len(toc.Files))
+	for i := range toc.Files {
+		byName[toc.Files[i].Name] = &toc.Files[i]
+	}
+
+	return &Image{path: imagePath, toc: toc, byName: byName}, nil
+}
+
+// Files returns every file entry in the image's TOC.
+func (img *Image) Files() []FileEntry {
+	return img.toc.Files
+}
+
+// ExtractPaths decompresses only the chunks covering names and writes them
+// under dst, preserving each file's relative path, mode and digest.
+func (img *Image) ExtractPaths(dst string, names []string) error {
+	return img.ExtractPathsWithProgress(dst, names, nil)
+}
+
+// ExtractPathsWithProgress is like ExtractPaths but, if progress is non-nil,
+// invokes it after each read of compressed bytes off the image with the
+// cumulative bytes read and the total compressed bytes covering names.
+func (img *Image) ExtractPathsWithProgress(dst string, names []string, progress func(done, total int64)) error {
+	f, err := os.Open(img.path)
+	if err != nil {
+		return fmt.Errorf("ExtractPathsWithProgress: %w", err)
+	}
+	defer f.Close()
+
+	entries := make([]*FileEntry, len(names))
+	var total int64
+	for i, name := range names {
+		entry, ok := img.byName[name]
+		if !ok {
+			return fmt.Errorf("ExtractPathsWithProgress: %s not found in TOC", name)
+		}
+		entries[i] = entry
+		total += entry.EndOffset - entry.StartOffset
+	}
+
+	var done int64
+	var onRead func(n int64)
+	if progress != nil {
+		onRead = func(n int64) {
+			done += n
+			progress(done, total)
+		}
+	}
+
+	for _, entry := range entries {
+		if err := extractOne(f, entry, dst, onRead); err != nil {
+			return fmt.Errorf("ExtractPathsWithProgress: %s: %w", entry.Name, err)
+		}
+	}
+	return nil
+}
+
+// countingReader wraps an io.Reader, invoking onRead with each successful
+// read's byte count.
+type countingReader struct {
+	r      io.Reader
+	onRead func(n int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.onRead(int64(n))
+	}
+	return n, err
+}
+
+// safeJoin joins dst and name the way filepath.Join would, but rejects names
+// that are absolute or that escape dst via "..", since name comes from the
+// TOC and a corrupted or malicious one must not be able to write outside dst.
+func safeJoin(dst, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("entry name %q is absolute", name)
+	}
+
+	cleaned := filepath.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry name %q escapes the destination directory", name)
+	}
+
+	return filepath.Join(dst, cleaned), nil
+}
+
+// extractOne decompresses entry's frame, which is independently decodable
+// from the rest of the image, using a fresh zstd decoder per call. If
+// onRead is non-nil it's called with each chunk of compressed bytes read.
+func extractOne(f *os.File, entry *FileEntry, dst string, onRead func(n int64)) error {
+	var chunk io.Reader = io.NewSectionReader(f, entry.StartOffset, entry.EndOffset-entry.StartOffset)
+	if onRead != nil {
+		chunk = &countingReader{r: chunk, onRead: onRead}
+	}
+
+	dec, err := zstd.NewReader(chunk)
+	if err != nil {
+		return fmt.Errorf("failed to open zstd frame: %w", err)
+	}
+	defer dec.Close()
+
+	outPath, err := safeJoin(dst, entry.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(outPath), err)
+	}
+
+	out, err := os.OpenFile(outPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(entry.Mode))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", outPath, err)
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), dec); err != nil {
+		return fmt.Errorf("failed to decompress: %w", err)
+	}
+
+	if sum := fmt.Sprintf("%x", hash.Sum(nil)); entry.Digest != "" && sum != entry.Digest {
+		return fmt.Errorf("digest mismatch: got %s, want %s", sum, entry.Digest)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package chunked
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// writeTestImage packs files into a chunked image with a valid footer/TOC,
+// one independent zstd frame per file, and returns its path.
+func writeTestImage(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+
+	imagePath := filepath.Join(dir, "image.dlc")
+	f, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+	defer f.Close()
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("failed to create zstd encoder: %v", err)
+	}
+	defer enc.Close()
+
+	var toc TOC
+	var offset int64
+	for name, content := range files {
+		compressed := enc.EncodeAll([]byte(content), nil)
+		if _, err := f.Write(compressed); err != nil {
+			t.Fatalf("failed to write frame for %s: %v", name, err)
+		}
+
+		sum := sha256.Sum256([]byte(content))
+		toc.Files = append(toc.Files, FileEntry{
+			Name:        name,
+			Mode:        0644,
+			Size:        int64(len(content)),
+			StartOffset: offset,
+			EndOffset:   offset + int64(len(compressed)),
+			Digest:      fmt.Sprintf("%x", sum),
+		})
+		offset += int64(len(compressed))
+	}
+
+	tocBytes, err := json.Marshal(toc)
+	if err != nil {
+		t.Fatalf("failed to marshal TOC: %v", err)
+	}
+	tocOffset := offset
+	if _, err := f.Write(tocBytes); err != nil {
+		t.Fatalf("failed to write TOC: %v", err)
+	}
+
+	tocSum := sha256.Sum256(tocBytes)
+	var ft footer
+	copy(ft.Magic[:], footerMagic)
+	ft.TOCOffset = uint64(tocOffset)
+	ft.TOCLength = uint64(len(tocBytes))
+	copy(ft.TOCDigest[:], tocSum[:8])
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, &ft); err != nil {
+		t.Fatalf("failed to encode footer: %v", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		t.Fatalf("failed to write footer: %v", err)
+	}
+
+	return imagePath
+}
+
+func TestOpenAndExtractPaths(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := writeTestImage(t, dir, map[string]string{
+		"a.txt": "hello",
+		"b.txt": "world",
+	})
+
+	img, err := Open(imagePath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	destDir := filepath.Join(dir, "out")
+	if err := img.ExtractPaths(destDir, []string{"a.txt"}); err != nil {
+		t.Fatalf("ExtractPaths: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(destDir, "a.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("got %q, want %q", got, "hello")
+	}
+
+	if _, err := os.Stat(filepath.Join(destDir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("b.txt should not have been extracted")
+	}
+}
+
+func TestOpenNoFooter(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "plain.img")
+	if err := os.WriteFile(imagePath, []byte("not a chunked image"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := Open(imagePath); !errors.Is(err, ErrNoFooter) {
+		t.Errorf("Open: got %v, want ErrNoFooter", err)
+	}
+}
+
+func TestExtractPathsRejectsTraversal(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := writeTestImage(t, dir, map[string]string{
+		"../escape.txt": "pwned",
+	})
+
+	img, err := Open(imagePath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if err := img.ExtractPaths(filepath.Join(dir, "out"), []string{"../escape.txt"}); err == nil {
+		t.Errorf("ExtractPaths: expected a path-traversal entry name to be rejected")
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package dlclib
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	unsquashfsPath = "/usr/bin/unsquashfs"
+	debugfsPath    = "/sbin/debugfs"
+	mountPath      = "/bin/mount"
+	umountPath     = "/bin/umount"
+	rsyncPath      = "/usr/bin/rsync"
+	fsckErofsPath  = "/sbin/fsck.erofs"
+	mksquashfsPath = "/usr/bin/mksquashfs"
+	mkfsExt4Path   = "/sbin/mkfs.ext4"
+	mkfsErofsPath  = "/sbin/mkfs.erofs"
+)
+
+// Packer rebuilds a filesystem image from a directory tree (typically one
+// produced by a prior Extractor.Extract), for dlctool's --repack. Not every
+// Extractor necessarily implements it.
+type Packer interface {
+	Pack(srcDir, imagePath string) error
+}
+
+// ProgressExtractor is implemented by Extractors that can report progress as
+// a percentage (0-100) while extracting. Not every Extractor implements it.
+type ProgressExtractor interface {
+	ExtractWithProgress(imagePath, destDir string, progress func(percent float64)) error
+}
+
+// Extractor knows how to recognize and unpack one DLC image filesystem
+// format.
+type Extractor interface {
+	// Name identifies the filesystem format, e.g. "squashfs".
+	Name() string
+	// Detect reports whether imagePath looks like this extractor's format.
+	Detect(imagePath string) (bool, error)
+	// Extract unpacks imagePath into destDir.
+	Extract(imagePath, destDir string) error
+}
+
+// extractors is probed in order; squashfs stays first since it's still the
+// common case.
+var extractors = []Extractor{
+	squashfsExtractor{},
+	ext4Extractor{},
+	erofsExtractor{},
+}
+
+// Extractors returns the registered Extractor implementations, in probe
+// order.
+func Extractors() []Extractor {
+	return extractors
+}
+
+// DetectExtractor probes imagePath's magic bytes against every registered
+// Extractor and returns the first match.
+func DetectExtractor(imagePath string) (Extractor, error) {
+	for _, e := range extractors {
+		ok, err := e.Detect(imagePath)
+		if err != nil {
+			return nil, fmt.Errorf("DetectExtractor: %s: %w", e.Name(), err)
+		}
+		if ok {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("DetectExtractor: no extractor recognized %s", imagePath)
+}
+
+// ExtractorByName looks up a registered Extractor by its Name(), for
+// --force-fs overrides.
+func ExtractorByName(name string) (Extractor, error) {
+	for _, e := range extractors {
+		if e.Name() == name {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("ExtractorByName: unknown filesystem %q", name)
+}
+
+// readMagic reads n bytes at offset from imagePath.
+func readMagic(imagePath string, offset int64, n int) ([]byte, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+const squashfsMagic = "hsqs"
+
+type squashfsExtractor struct{}
+
+func (squashfsExtractor) Name() string { return "squashfs" }
+
+func (squashfsExtractor) Detect(imagePath string) (bool, error) {
+	magic, err := readMagic(imagePath, 0, len(squashfsMagic))
+	if err != nil {
+		return false, err
+	}
+	return string(magic) == squashfsMagic, nil
+}
+
+func (squashfsExtractor) Extract(imagePath, destDir string) error {
+	cmd := &exec.Cmd{
+		Path: unsquashfsPath,
+		Args: []string{unsquashfsPath, "-d", destDir, imagePath},
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("squashfsExtractor: failed to decompress: %w", err)
+	}
+	return nil
+}
+
+// ExtractWithProgress is like Extract but parses unsquashfs's -percentage
+// output to report progress, implementing ProgressExtractor.
+func (squashfsExtractor) ExtractWithProgress(imagePath, destDir string, progress func(percent float64)) error {
+	cmd := &exec.Cmd{
+		Path: unsquashfsPath,
+		Args: []string{unsquashfsPath, "-d", destDir, "-percentage", imagePath},
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("squashfsExtractor: failed to open stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("squashfsExtractor: failed to start: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(scanner.Text(), "%"), 64)
+		if err != nil {
+			continue
+		}
+		if progress != nil {
+			progress(pct)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("squashfsExtractor: failed to decompress: %w", err)
+	}
+	return nil
+}
+
+// Pack rebuilds imagePath from srcDir via mksquashfs, implementing Packer.
+func (squashfsExtractor) Pack(srcDir, imagePath string) error {
+	if err := os.Remove(imagePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("squashfsExtractor: failed to remove stale image: %w", err)
+	}
+
+	cmd := &exec.Cmd{
+		Path: mksquashfsPath,
+		Args: []string{mksquashfsPath, srcDir, imagePath, "-noappend", "-all-root"},
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("squashfsExtractor: failed to build image: %w", err)
+	}
+	return nil
+}
+
+const (
+	ext4SuperblockOffset = 0x400
+	ext4MagicOffset      = 0x38
+	ext4Magic            = 0xEF53
+)
+
+type ext4Extractor struct{}
+
+func (ext4Extractor) Name() string { return "ext4" }
+
+func (ext4Extractor) Detect(imagePath string) (bool, error) {
+	magic, err := readMagic(imagePath, ext4SuperblockOffset+ext4MagicOffset, 2)
+	if err != nil {
+		return false, err
+	}
+	return binary.LittleEndian.Uint16(magic) == ext4Magic, nil
+}
+
+// Extract prefers debugfs's rdump, which reads the image directly without
+// mounting it. If debugfs isn't available it falls back to a loop mount and
+// an rsync copy out.
+func (ext4Extractor) Extract(imagePath, destDir string) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("ext4Extractor: failed to create %s: %w", destDir, err)
+	}
+
+	cmd := &exec.Cmd{
+		Path: debugfsPath,
+		Args: []string{debugfsPath, "-R", fmt.Sprintf("rdump / %s", destDir), imagePath},
+	}
+	if err := cmd.Run(); err == nil {
+		return nil
+	}
+
+	return ext4ExtractViaLoopMount(imagePath, destDir)
+}
+
+// Pack rebuilds imagePath from srcDir via mkfs.ext4 -d, implementing Packer.
+// The image is pre-sized with 10% headroom for filesystem metadata.
+func (ext4Extractor) Pack(srcDir, imagePath string) error {
+	dirSize, err := dirSizeBytes(srcDir)
+	if err != nil {
+		return fmt.Errorf("ext4Extractor: failed to size %s: %w", srcDir, err)
+	}
+	size := ext4ImageSize(dirSize)
+
+	f, err := os.Create(imagePath)
+	if err != nil {
+		return fmt.Errorf("ext4Extractor: failed to create image: %w", err)
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return fmt.Errorf("ext4Extractor: failed to size image: %w", err)
+	}
+	f.Close()
+
+	cmd := &exec.Cmd{
+		Path: mkfsExt4Path,
+		Args: []string{mkfsExt4Path, "-F", "-d", srcDir, imagePath},
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ext4Extractor: failed to build image: %w", err)
+	}
+	return nil
+}
+
+// ext4ImageSize returns how large an ext4 image should be pre-truncated to
+// before mkfs.ext4 -d is pointed at a directory of dirSize bytes, adding 10%
+// headroom plus 1MiB for filesystem metadata.
+func ext4ImageSize(dirSize int64) int64 {
+	return dirSize + dirSize/10 + 1<<20
+}
+
+func dirSizeBytes(dir string) (int64, error) {
+	var total int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+func ext4ExtractViaLoopMount(imagePath, destDir string) error {
+	mountDir, err := os.MkdirTemp("", "dlc-ext4-mount-*")
+	if err != nil {
+		return fmt.Errorf("ext4Extractor: failed to create mount dir: %w", err)
+	}
+	defer os.RemoveAll(mountDir)
+
+	mount := &exec.Cmd{
+		Path: mountPath,
+		Args: []string{mountPath, "-o", "loop,ro", imagePath, mountDir},
+	}
+	if err := mount.Run(); err != nil {
+		return fmt.Errorf("ext4Extractor: failed to loop-mount %s: %w", imagePath, err)
+	}
+	defer func() {
+		umount := &exec.Cmd{Path: umountPath, Args: []string{umountPath, mountDir}}
+		umount.Run()
+	}()
+
+	rsync := &exec.Cmd{
+		Path: rsyncPath,
+		Args: []string{rsyncPath, "-a", mountDir + "/", destDir + "/"},
+	}
+	if err := rsync.Run(); err != nil {
+		return fmt.Errorf("ext4Extractor: failed to rsync from %s: %w", mountDir, err)
+	}
+	return nil
+}
+
+const (
+	erofsSuperblockOffset = 1024
+	erofsMagic            = 0xE0F5E1E2
+)
+
+type erofsExtractor struct{}
+
+func (erofsExtractor) Name() string { return "erofs" }
+
+func (erofsExtractor) Detect(imagePath string) (bool, error) {
+	magic, err := readMagic(imagePath, erofsSuperblockOffset, 4)
+	if err != nil {
+		return false, err
+	}
+	return binary.LittleEndian.Uint32(magic) == erofsMagic, nil
+}
+
+func (erofsExtractor) Extract(imagePath, destDir string) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("erofsExtractor: failed to create %s: %w", destDir, err)
+	}
+
+	cmd := &exec.Cmd{
+		Path: fsckErofsPath,
+		Args: []string{fsckErofsPath, "--extract=" + destDir, imagePath},
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("erofsExtractor: failed to extract: %w", err)
+	}
+	return nil
+}
+
+// Pack rebuilds imagePath from srcDir via mkfs.erofs, implementing Packer.
+func (erofsExtractor) Pack(srcDir, imagePath string) error {
+	if err := os.Remove(imagePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("erofsExtractor: failed to remove stale image: %w", err)
+	}
+
+	cmd := &exec.Cmd{
+		Path: mkfsErofsPath,
+		Args: []string{mkfsErofsPath, imagePath, srcDir},
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("erofsExtractor: failed to build image: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package dlclib
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeImageWithMagic(t *testing.T, offset int64, magic []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "image")
+	buf := make([]byte, offset+int64(len(magic)))
+	copy(buf[offset:], magic)
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestSquashfsDetect(t *testing.T) {
+	path := writeImageWithMagic(t, 0, []byte(squashfsMagic))
+	ok, err := (squashfsExtractor{}).Detect(path)
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if !ok {
+		t.Errorf("Detect: got false, want true for a squashfs magic")
+	}
+}
+
+func TestExt4Detect(t *testing.T) {
+	magic := make([]byte, 2)
+	binary.LittleEndian.PutUint16(magic, ext4Magic)
+	path := writeImageWithMagic(t, ext4SuperblockOffset+ext4MagicOffset, magic)
+
+	ok, err := (ext4Extractor{}).Detect(path)
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if !ok {
+		t.Errorf("Detect: got false, want true for an ext4 magic")
+	}
+}
+
+func TestErofsDetect(t *testing.T) {
+	magic := make([]byte, 4)
+	binary.LittleEndian.PutUint32(magic, erofsMagic)
+	path := writeImageWithMagic(t, erofsSuperblockOffset, magic)
+
+	ok, err := (erofsExtractor{}).Detect(path)
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if !ok {
+		t.Errorf("Detect: got false, want true for an erofs magic")
+	}
+}
+
+func TestDetectExtractorNoMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image")
+	if err := os.WriteFile(path, []byte("not a recognized filesystem"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := DetectExtractor(path); err == nil {
+		t.Errorf("DetectExtractor: expected an error for an unrecognized image")
+	}
+}
+
+func TestDetectExtractorPicksFirstMatch(t *testing.T) {
+	path := writeImageWithMagic(t, 0, []byte(squashfsMagic))
+	e, err := DetectExtractor(path)
+	if err != nil {
+		t.Fatalf("DetectExtractor: %v", err)
+	}
+	if e.Name() != "squashfs" {
+		t.Errorf("DetectExtractor: got %s, want squashfs", e.Name())
+	}
+}
+
+func TestExtractorByName(t *testing.T) {
+	if _, err := ExtractorByName("ext4"); err != nil {
+		t.Errorf("ExtractorByName(ext4): %v", err)
+	}
+	if _, err := ExtractorByName("not-a-filesystem"); err == nil {
+		t.Errorf("ExtractorByName: expected an error for an unknown name")
+	}
+}
+
+func TestDirSizeBytes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a"), make([]byte, 100), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "b"), make([]byte, 50), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	got, err := dirSizeBytes(dir)
+	if err != nil {
+		t.Fatalf("dirSizeBytes: %v", err)
+	}
+	if got != 150 {
+		t.Errorf("dirSizeBytes = %d, want 150", got)
+	}
+}
+
+func TestExt4ImageSize(t *testing.T) {
+	cases := []struct {
+		dirSize int64
+		want    int64
+	}{
+		{dirSize: 0, want: 1 << 20},
+		{dirSize: 10 << 20, want: 10<<20 + 1<<20 + 1<<20},
+		{dirSize: 100, want: 100 + 10 + 1<<20},
+	}
+	for _, c := range cases {
+		if got := ext4ImageSize(c.dirSize); got != c.want {
+			t.Errorf("ext4ImageSize(%d) = %d, want %d", c.dirSize, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package dlclib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// ManifestDir is the root directory imageloader reads DLC manifests from.
+const ManifestDir = "/opt/google/dlc"
+
+// Manifest is the subset of a DLC's imageloader manifest that dlctool's
+// --repack needs to patch after rebuilding an image.
+type Manifest struct {
+	ImageType       string `json:"image-type,omitempty"`
+	ImageSha256Hash string `json:"image-sha256-hash"`
+	TableSha256Hash string `json:"table-sha256-hash,omitempty"`
+	Size            string `json:"size"`
+	Version         string `json:"version,omitempty"`
+	Signature       string `json:"signature,omitempty"`
+}
+
+// ManifestPath returns id's on-device imageloader.json path.
+func ManifestPath(id string) string {
+	return path.Join(ManifestDir, id, "package", "imageloader.json")
+}
+
+// ReadManifest reads and unmarshals the "manifest" section of
+// MetadataUtil.Read(id).
+func ReadManifest(id *string) (*Manifest, error) {
+	out, err := MetadataUtil.Read(id)
+	if err != nil {
+		return nil, fmt.Errorf("ReadManifest: failed to read metadata: %w", err)
+	}
+
+	wrapper := struct {
+		Manifest Manifest `json:"manifest"`
+	}{}
+	if err := json.Unmarshal(out, &wrapper); err != nil {
+		return nil, fmt.Errorf("ReadManifest: failed to unmarshal DLC (%s): %w", *id, err)
+	}
+	return &wrapper.Manifest, nil
+}
+
+// WriteManifest serializes m and writes it to id's ManifestPath.
+func WriteManifest(id *string, m *Manifest) error {
+	wrapper := struct {
+		Manifest Manifest `json:"manifest"`
+	}{Manifest: *m}
+
+	b, err := json.MarshalIndent(wrapper, "", "  ")
+	if err != nil {
+		return fmt.Errorf("WriteManifest: failed to marshal DLC (%s): %w", *id, err)
+	}
+
+	if err := os.WriteFile(ManifestPath(*id), b, 0644); err != nil {
+		return fmt.Errorf("WriteManifest: failed to write DLC (%s): %w", *id, err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package dlclib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.chromium.org/chromiumos/dlc/dlclib/chunked"
+)
+
+// VerifyResult is the structured diff produced by Verify.
+type VerifyResult struct {
+	Missing []string `json:"missing,omitempty"`
+	Extra   []string `json:"extra,omitempty"`
+	Corrupt []string `json:"corrupt,omitempty"`
+}
+
+// OK reports whether every file Verify checked matched what's on disk.
+func (r *VerifyResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Corrupt) == 0
+}
+
+// ErrNoTOC is returned by Verify when imagePath has no chunked TOC to source
+// per-file digests from, so callers can decide whether that's fatal (an
+// explicit --verify) or something to warn about and skip (default-on
+// verification of a DLC that predates the chunked format).
+var ErrNoTOC = errors.New("dlclib: image has no chunked TOC to verify per-file digests against")
+
+// Verify walks every file listed in imagePath's chunked TOC, computes the
+// sha256 of the copy in unpackDir, and reports any mismatch against the
+// TOC's per-file digest. Files present in unpackDir but absent from the TOC
+// are reported as extra.
+//
+// A plain DLC manifest only carries a whole-image sha256 and a hash of the
+// filesystem's own index, neither of which says anything about individual
+// files, so Verify has no real per-file integrity data to check images
+// without a chunked TOC against; it returns ErrNoTOC for those rather than
+// silently reporting success.
+func Verify(id *string, imagePath, unpackDir string) (*VerifyResult, error) {
+	img, err := chunked.Open(imagePath)
+	if err != nil {
+		if errors.Is(err, chunked.ErrNoFooter) {
+			return nil, fmt.Errorf("Verify: DLC (%s): %w", *id, ErrNoTOC)
+		}
+		return nil, fmt.Errorf("Verify: %w", err)
+	}
+
+	result := &VerifyResult{}
+	listed := make(map[string]bool, len(img.Files()))
+
+	for _, entry := range img.Files() {
+		listed[entry.Name] = true
+
+		sum, err := Sha256Sum(filepath.Join(unpackDir, entry.Name))
+		if os.IsNotExist(err) {
+			result.Missing = append(result.Missing, entry.Name)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Verify: failed to hash %s: %w", entry.Name, err)
+		}
+		if entry.Digest != "" && sum != entry.Digest {
+			result.Corrupt = append(result.Corrupt, entry.Name)
+		}
+	}
+
+	err = filepath.Walk(unpackDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(unpackDir, p)
+		if err != nil {
+			return err
+		}
+		if !listed[rel] {
+			result.Extra = append(result.Extra, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Verify: failed to walk %s: %w", unpackDir, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package dlclib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// writeTestImage builds a minimal chunked image (one zstd frame per file,
+// plus a TOC and footer matching the dlclib/chunked format) for Verify to
+// read per-file digests out of.
+func writeTestImage(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+
+	type fileEntry struct {
+		Name        string `json:"name"`
+		Mode        uint32 `json:"mode"`
+		Size        int64  `json:"size"`
+		UID         int    `json:"uid"`
+		GID         int    `json:"gid"`
+		StartOffset int64  `json:"startOffset"`
+		EndOffset   int64  `json:"endOffset"`
+		Digest      string `json:"digest"`
+	}
+	type toc struct {
+		Files []fileEntry `json:"files"`
+	}
+
+	imagePath := filepath.Join(dir, "image.dlc")
+	f, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+	defer f.Close()
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("failed to create zstd encoder: %v", err)
+	}
+	defer enc.Close()
+
+	var tc toc
+	var offset int64
+	for name, content := range files {
+		compressed := enc.EncodeAll([]byte(content), nil)
+		if _, err := f.Write(compressed); err != nil {
+			t.Fatalf("failed to write frame for %s: %v", name, err)
+		}
+
+		sum := sha256.Sum256([]byte(content))
+		tc.Files = append(tc.Files, fileEntry{
+			Name:        name,
+			Mode:        0644,
+			Size:        int64(len(content)),
+			StartOffset: offset,
+			EndOffset:   offset + int64(len(compressed)),
+			Digest:      fmt.Sprintf("%x", sum),
+		})
+		offset += int64(len(compressed))
+	}
+
+	tocBytes, err := json.Marshal(tc)
+	if err != nil {
+		t.Fatalf("failed to marshal TOC: %v", err)
+	}
+	tocOffset := offset
+	if _, err := f.Write(tocBytes); err != nil {
+		t.Fatalf("failed to write TOC: %v", err)
+	}
+
+	tocSum := sha256.Sum256(tocBytes)
+
+	buf := &bytes.Buffer{}
+	var magic [8]byte
+	copy(magic[:], "DLCCHNK1")
+	if err := binary.Write(buf, binary.LittleEndian, magic); err != nil {
+		t.Fatalf("failed to encode footer magic: %v", err)
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint64(tocOffset)); err != nil {
+		t.Fatalf("failed to encode TOC offset: %v", err)
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint64(len(tocBytes))); err != nil {
+		t.Fatalf("failed to encode TOC length: %v", err)
+	}
+	var digest [8]byte
+	copy(digest[:], tocSum[:8])
+	if err := binary.Write(buf, binary.LittleEndian, digest); err != nil {
+		t.Fatalf("failed to encode TOC digest: %v", err)
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint64(0)); err != nil {
+		t.Fatalf("failed to encode reserved footer bytes: %v", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		t.Fatalf("failed to write footer: %v", err)
+	}
+
+	return imagePath
+}
+
+func TestVerifyOK(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := writeTestImage(t, dir, map[string]string{"a.txt": "hello"})
+
+	unpackDir := filepath.Join(dir, "unpacked")
+	if err := os.MkdirAll(unpackDir, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(unpackDir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	id := "test-dlc"
+	result, err := Verify(&id, imagePath, unpackDir)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !result.OK() {
+		t.Errorf("Verify: got %+v, want OK", result)
+	}
+}
+
+func TestVerifyDetectsMismatches(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := writeTestImage(t, dir, map[string]string{
+		"a.txt": "hello",
+		"b.txt": "world",
+	})
+
+	unpackDir := filepath.Join(dir, "unpacked")
+	if err := os.MkdirAll(unpackDir, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	// a.txt tampered, b.txt missing, c.txt extra.
+	if err := os.WriteFile(filepath.Join(unpackDir, "a.txt"), []byte("tampered"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(unpackDir, "c.txt"), []byte("extra"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	id := "test-dlc"
+	result, err := Verify(&id, imagePath, unpackDir)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if result.OK() {
+		t.Fatalf("Verify: expected mismatches, got OK")
+	}
+	if len(result.Corrupt) != 1 || result.Corrupt[0] != "a.txt" {
+		t.Errorf("Corrupt = %v, want [a.txt]", result.Corrupt)
+	}
+	if len(result.Missing) != 1 || result.Missing[0] != "b.txt" {
+		t.Errorf("Missing = %v, want [b.txt]", result.Missing)
+	}
+	if len(result.Extra) != 1 || result.Extra[0] != "c.txt" {
+		t.Errorf("Extra = %v, want [c.txt]", result.Extra)
+	}
+}
+
+func TestVerifyNoChunkedTOC(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "plain.img")
+	if err := os.WriteFile(imagePath, []byte("not chunked"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	id := "test-dlc"
+	if _, err := Verify(&id, imagePath, t.TempDir()); !errors.Is(err, ErrNoTOC) {
+		t.Errorf("Verify: got %v, want ErrNoTOC", err)
+	}
+}
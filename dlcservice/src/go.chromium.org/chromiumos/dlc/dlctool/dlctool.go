@@ -7,20 +7,20 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path"
+	"strings"
+	"sync"
 
 	"go.chromium.org/chromiumos/dlc/dlclib"
+	"go.chromium.org/chromiumos/dlc/dlclib/chunked"
 	"go.chromium.org/chromiumos/dlc/dlctool/parse"
 )
 
-const (
-	unsquashfsPath = "/usr/bin/unsquashfs"
-)
-
 func dlctoolShell(args []string) {
 	cmd := &exec.Cmd{
 		Path:   dlclib.ToolShellPath,
@@ -34,22 +34,20 @@ func dlctoolShell(args []string) {
 	}
 }
 
-func isDlcInstalled(id *string) bool {
+func isDlcInstalled(id *string) (bool, error) {
 	out, err := dlclib.Util.Read(id)
 	if err != nil {
-		log.Fatalf("Failed to read state: %v", err)
+		return false, fmt.Errorf("isDlcInstalled: failed to read state: %w", err)
 	}
 
 	state := struct {
 		State int `json:"state"`
 	}{}
-	err = json.Unmarshal(out, &state)
-
-	if err != nil {
-		log.Fatalf("Failed to unmarshal DLC (%s) state", *id)
+	if err := json.Unmarshal(out, &state); err != nil {
+		return false, fmt.Errorf("isDlcInstalled: failed to unmarshal DLC (%s) state: %w", *id, err)
 	}
 
-	return state.State == 2
+	return state.State == 2, nil
 }
 
 func isDlcPreloadable(id *string) bool {
@@ -57,10 +55,10 @@ func isDlcPreloadable(id *string) bool {
 	return !os.IsNotExist(err)
 }
 
-func isDlcScaled(id *string) bool {
+func isDlcScaled(id *string) (bool, error) {
 	out, err := dlclib.MetadataUtil.Read(id)
 	if err != nil {
-		log.Fatalf("Failed to read metadata: %v", err)
+		return false, fmt.Errorf("isDlcScaled: failed to read metadata: %w", err)
 	}
 
 	metadata := struct {
@@ -68,19 +66,17 @@ func isDlcScaled(id *string) bool {
 			Scaled bool `json:"scaled"`
 		} `json:"manifest"`
 	}{}
-	err = json.Unmarshal(out, &metadata)
-
-	if err != nil {
-		log.Fatalf("Failed to unmarshal DLC (%s)", *id)
+	if err := json.Unmarshal(out, &metadata); err != nil {
+		return false, fmt.Errorf("isDlcScaled: failed to unmarshal DLC (%s): %w", *id, err)
 	}
 
-	return metadata.Manifest.Scaled
+	return metadata.Manifest.Scaled, nil
 }
 
-func isDlcForceOTA(id *string) bool {
+func isDlcForceOTA(id *string) (bool, error) {
 	out, err := dlclib.MetadataUtil.Read(id)
 	if err != nil {
-		log.Fatalf("Failed to read metadata: %v", err)
+		return false, fmt.Errorf("isDlcForceOTA: failed to read metadata: %w", err)
 	}
 
 	metadata := struct {
@@ -88,13 +84,11 @@ func isDlcForceOTA(id *string) bool {
 			ForceOTA bool `json:"force-ota"`
 		} `json:"manifest"`
 	}{}
-	err = json.Unmarshal(out, &metadata)
-
-	if err != nil {
-		log.Fatalf("Failed to unmarshal DLC (%s)", *id)
+	if err := json.Unmarshal(out, &metadata); err != nil {
+		return false, fmt.Errorf("isDlcForceOTA: failed to unmarshal DLC (%s): %w", *id, err)
 	}
 
-	return metadata.Manifest.ForceOTA
+	return metadata.Manifest.ForceOTA, nil
 }
 
 func getDlcImagePath(id *string) string {
@@ -123,43 +117,196 @@ func installDlc(id *string) error {
 	return cmd.Run()
 }
 
+// tryInstallingDlc installs id if it isn't already installed. It never calls
+// log.Fatalf so it's safe to run from any of the concurrent installers below.
 func tryInstallingDlc(id *string) error {
-	if isDlcInstalled(id) {
+	installed, err := isDlcInstalled(id)
+	if err != nil {
+		return fmt.Errorf("tryInstallingDlc: %w", err)
+	}
+	if installed {
 		log.Printf("DLC (%s) is already installed, continuing...\n", *id)
 		return nil
 	}
 
-	if isDlcPreloadable(id) {
+	emitInstallStart(*id)
+
+	switch {
+	case isDlcPreloadable(id):
 		log.Printf("Trying to install DLC (%s) because it's preloaded.\n", *id)
-	} else if isDlcScaled(id) {
-		log.Printf("Trying to install DLC (%s) because it's scaled.\n", *id)
-	} else if isDlcForceOTA(id) {
-		log.Printf("Trying to install DLC (%s) because it's force-ota.\n", *id)
-	} else {
-		return fmt.Errorf("tryInstallingDlc failed: Can't install DLC (%s)", *id)
+	default:
+		scaled, err := isDlcScaled(id)
+		if err != nil {
+			return fmt.Errorf("tryInstallingDlc: %w", err)
+		}
+		forceOTA, err := isDlcForceOTA(id)
+		if err != nil {
+			return fmt.Errorf("tryInstallingDlc: %w", err)
+		}
+
+		switch {
+		case scaled:
+			log.Printf("Trying to install DLC (%s) because it's scaled.\n", *id)
+		case forceOTA:
+			log.Printf("Trying to install DLC (%s) because it's force-ota.\n", *id)
+		default:
+			return fmt.Errorf("tryInstallingDlc failed: can't install DLC (%s)", *id)
+		}
 	}
 
 	if err := installDlc(id); err != nil {
 		return fmt.Errorf("tryInstallingDlc failed: %w", err)
 	}
 	log.Printf("Installed DLC (%s)\n", *id)
+	emitInstallDone(*id)
 	return nil
 }
 
+// dlcSpec pairs a DLC ID with the directory it should be unpacked to, as
+// parsed positionally from --ids and --out-dir.
+type dlcSpec struct {
+	id     string
+	outDir string
+}
+
+// parseSpecs splits the comma-separated --ids and --out-dir flags into one
+// dlcSpec per DLC. --out-dir is required and must name one distinct,
+// non-empty destination per ID.
+func parseSpecs(ids, outDirs string) ([]dlcSpec, error) {
+	idList := strings.Split(ids, ",")
+
+	if outDirs == "" {
+		return nil, fmt.Errorf("parseSpecs: --out-dir is required when --ids is used")
+	}
+
+	outList := strings.Split(outDirs, ",")
+	if len(outList) != len(idList) {
+		return nil, fmt.Errorf("parseSpecs: got %d --ids but %d --out-dir entries", len(idList), len(outList))
+	}
+
+	specs := make([]dlcSpec, len(idList))
+	seen := make(map[string]bool, len(outList))
+	for i, id := range idList {
+		outDir := strings.TrimSpace(outList[i])
+		if outDir == "" {
+			return nil, fmt.Errorf("parseSpecs: --out-dir entry %d is empty", i+1)
+		}
+		if seen[outDir] {
+			return nil, fmt.Errorf("parseSpecs: --out-dir %s is repeated; every DLC needs its own destination", outDir)
+		}
+		seen[outDir] = true
+
+		specs[i].id = strings.TrimSpace(id)
+		specs[i].outDir = outDir
+	}
+	return specs, nil
+}
+
+// installDlcsConcurrently installs every DLC in specs, spawning one goroutine
+// per spec (capped at maxParallel in flight) and joining any per-DLC
+// failures into a single error so one bad DLC doesn't abort the rest.
+func installDlcsConcurrently(specs []dlcSpec, maxParallel int) error {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+
+	sem := make(chan struct{}, maxParallel)
+	errs := make(chan error, len(specs))
+
+	var wg sync.WaitGroup
+	for _, spec := range specs {
+		spec := spec
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := tryInstallingDlc(&spec.id); err != nil {
+				emitError(spec.id, err)
+				errs <- fmt.Errorf("DLC (%s): %w", spec.id, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return errors.Join(all...)
+}
+
 func extractDlc(id, path *string) error {
-	// TODO(b/335722339): Add support for other filesystems based on image type.
-	cmd := &exec.Cmd{
-		Path: unsquashfsPath,
-		Args: []string{unsquashfsPath, "-d", *path, getDlcImagePath(id)},
+	imagePath := getDlcImagePath(id)
+
+	img, err := chunked.Open(imagePath)
+	if err == nil {
+		return extractChunkedDlc(*id, img, path)
+	}
+	if !errors.Is(err, chunked.ErrNoFooter) {
+		return fmt.Errorf("extractDlc: failed to open chunked image: %w", err)
 	}
 
-	if err := cmd.Run(); err != nil {
+	extractor, err := dlcExtractor(imagePath)
+	if err != nil {
+		return fmt.Errorf("extractDlc: %w", err)
+	}
+
+	progress := func(pct float64) { emitExtractProgress(*id, int64(pct), 100) }
+	if pe, ok := extractor.(dlclib.ProgressExtractor); ok && jsonOutput {
+		err = pe.ExtractWithProgress(imagePath, *path, progress)
+	} else {
+		err = extractor.Extract(imagePath, *path)
+	}
+	if err != nil {
 		return fmt.Errorf("extractDlc: failed to decompress: %w", err)
 	}
 
 	return nil
 }
 
+// extractChunkedDlc pulls --files out of a chunked image if given, or every
+// file in its TOC otherwise.
+func extractChunkedDlc(id string, img *chunked.Image, path *string) error {
+	if err := os.MkdirAll(*path, 0755); err != nil {
+		return fmt.Errorf("extractChunkedDlc: failed to create %s: %w", *path, err)
+	}
+
+	names := chunkedRequestedNames(img.Files())
+
+	var progress func(done, total int64)
+	if jsonOutput {
+		progress = func(done, total int64) { emitExtractProgress(id, done, total) }
+	}
+
+	if err := img.ExtractPathsWithProgress(*path, names, progress); err != nil {
+		return fmt.Errorf("extractChunkedDlc: %w", err)
+	}
+	return nil
+}
+
+func chunkedRequestedNames(all []chunked.FileEntry) []string {
+	if *parse.FlagFiles == "" {
+		names := make([]string, len(all))
+		for i, f := range all {
+			names[i] = f.Name
+		}
+		return names
+	}
+	return strings.Split(*parse.FlagFiles, ",")
+}
+
+// dlcExtractor picks the dlclib.Extractor for imagePath, honoring
+// --force-fs if set and otherwise probing the image's magic bytes.
+func dlcExtractor(imagePath string) (dlclib.Extractor, error) {
+	if *parse.FlagForceFS != "" {
+		return dlclib.ExtractorByName(*parse.FlagForceFS)
+	}
+	return dlclib.DetectExtractor(imagePath)
+}
+
 func unpackDlc(id, path *string) error {
 	if _, err := os.Stat(*path); !os.IsNotExist(err) {
 		return fmt.Errorf("%s is a path which already exists", *path)
@@ -173,24 +320,81 @@ func unpackDlc(id, path *string) error {
 		return fmt.Errorf("unpackDlc: failed extracting: %w", err)
 	}
 
+	if err := maybeVerifyDlc(id, *path); err != nil {
+		return fmt.Errorf("unpackDlc: %w", err)
+	}
+
 	return nil
 }
 
+// unpackDlcs installs every DLC in specs concurrently (bounded by
+// maxParallel), then extracts each one in sequence. The extract step is
+// serialized across specs: unsquashfs is already disk-I/O bound and running
+// several at once per output path races on the destination, so only the
+// install step is parallelized.
+func unpackDlcs(specs []dlcSpec, maxParallel int) error {
+	for _, spec := range specs {
+		if _, err := os.Stat(spec.outDir); !os.IsNotExist(err) {
+			return fmt.Errorf("unpackDlcs: %s is a path which already exists", spec.outDir)
+		}
+	}
+
+	if err := installDlcsConcurrently(specs, maxParallel); err != nil {
+		return fmt.Errorf("unpackDlcs: failed installing DLCs: %w", err)
+	}
+
+	var errs []error
+	for _, spec := range specs {
+		if err := extractDlc(&spec.id, &spec.outDir); err != nil {
+			errs = append(errs, fmt.Errorf("DLC (%s): %w", spec.id, err))
+			continue
+		}
+		if err := maybeVerifyDlc(&spec.id, spec.outDir); err != nil {
+			errs = append(errs, fmt.Errorf("DLC (%s): %w", spec.id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func main() {
 	dlclib.Init()
 	p, err := parse.Args(os.Args[0], os.Args[1:])
 	if err != nil {
 		log.Fatalf("Parsing flags failed: %v", err)
 	}
+	initOutput()
 
 	if *parse.FlagUnpack {
+		if *parse.FlagIDs != "" {
+			specs, err := parseSpecs(*parse.FlagIDs, *parse.FlagOutDir)
+			if err != nil {
+				log.Fatalf("Parsing --ids/--out-dir failed: %v", err)
+			}
+			log.Printf("Unpacking %d DLCs (max-parallel=%d)\n", len(specs), *parse.FlagMaxParallel)
+			if err := unpackDlcs(specs, *parse.FlagMaxParallel); err != nil {
+				emitError(*parse.FlagIDs, err)
+				log.Fatalf("Unpacking DLCs failed: %v", err)
+			}
+			return
+		}
+
 		log.Printf("Unpacking DLC (%s) to: %s\n", *parse.FlagID, p)
 		if err := unpackDlc(parse.FlagID, &p); err != nil {
+			emitError(*parse.FlagID, err)
 			log.Fatalf("Unpacking DLC (%s) failed: %v", *parse.FlagID, err)
 		}
 		return
 	}
 
+	if *parse.FlagRepack {
+		log.Printf("Repacking DLC (%s) from: %s\n", *parse.FlagID, p)
+		if err := repackDlc(parse.FlagID, &p, *parse.FlagDryRun, *parse.FlagSignKey); err != nil {
+			emitError(*parse.FlagID, err)
+			log.Fatalf("Repacking DLC (%s) failed: %v", *parse.FlagID, err)
+		}
+		return
+	}
+
 	if *parse.FlagShell {
 		dlctoolShell(os.Args[1:])
 		return
@@ -0,0 +1,82 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestParseSpecs(t *testing.T) {
+	cases := []struct {
+		name      string
+		ids       string
+		outDirs   string
+		wantErr   bool
+		wantSpecs []dlcSpec
+	}{
+		{
+			name:    "single id with out-dir",
+			ids:     "foo",
+			outDirs: "/tmp/foo",
+			wantSpecs: []dlcSpec{
+				{id: "foo", outDir: "/tmp/foo"},
+			},
+		},
+		{
+			name:    "multiple ids with out-dirs",
+			ids:     "foo,bar",
+			outDirs: "/tmp/foo,/tmp/bar",
+			wantSpecs: []dlcSpec{
+				{id: "foo", outDir: "/tmp/foo"},
+				{id: "bar", outDir: "/tmp/bar"},
+			},
+		},
+		{
+			name:    "single id without out-dir is rejected",
+			ids:     "foo",
+			outDirs: "",
+			wantErr: true,
+		},
+		{
+			name:    "mismatched counts rejected",
+			ids:     "foo,bar",
+			outDirs: "/tmp/foo",
+			wantErr: true,
+		},
+		{
+			name:    "empty out-dir entry rejected",
+			ids:     "foo,bar",
+			outDirs: "/tmp/foo,",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate out-dir entries rejected",
+			ids:     "foo,bar",
+			outDirs: "/tmp/same,/tmp/same",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseSpecs(c.ids, c.outDirs)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("parseSpecs(%q, %q): expected an error, got %+v", c.ids, c.outDirs, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSpecs(%q, %q): %v", c.ids, c.outDirs, err)
+			}
+			if len(got) != len(c.wantSpecs) {
+				t.Fatalf("parseSpecs(%q, %q) = %+v, want %+v", c.ids, c.outDirs, got, c.wantSpecs)
+			}
+			for i := range got {
+				if got[i] != c.wantSpecs[i] {
+					t.Errorf("spec %d = %+v, want %+v", i, got[i], c.wantSpecs[i])
+				}
+			}
+		})
+	}
+}
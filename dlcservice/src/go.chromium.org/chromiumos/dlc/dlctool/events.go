@@ -0,0 +1,69 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"go.chromium.org/chromiumos/dlc/dlclib"
+	"go.chromium.org/chromiumos/dlc/dlctool/parse"
+)
+
+// event is one newline-delimited JSON line emitted on stdout under
+// --output=json.
+type event struct {
+	Event  string               `json:"event"`
+	ID     string               `json:"id,omitempty"`
+	Bytes  int64                `json:"bytes,omitempty"`
+	Total  int64                `json:"total,omitempty"`
+	Verify *dlclib.VerifyResult `json:"verify,omitempty"`
+	Error  string               `json:"error,omitempty"`
+}
+
+// jsonOutput is true once initOutput has detected --output=json.
+var jsonOutput bool
+
+// emitWriter is where emit prints event lines; overridable by tests.
+var emitWriter io.Writer = os.Stdout
+
+// initOutput switches human logging to stderr when --output=json, keeping
+// stdout clean for the event stream.
+func initOutput() {
+	jsonOutput = *parse.FlagOutput == "json"
+	if jsonOutput {
+		log.SetOutput(os.Stderr)
+	}
+}
+
+func emit(e event) {
+	if !jsonOutput {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("emit: failed to marshal %s event: %v", e.Event, err)
+		return
+	}
+	fmt.Fprintln(emitWriter, string(b))
+}
+
+func emitInstallStart(id string) { emit(event{Event: "install_start", ID: id}) }
+func emitInstallDone(id string)  { emit(event{Event: "install_done", ID: id}) }
+
+func emitExtractProgress(id string, bytes, total int64) {
+	emit(event{Event: "extract_progress", ID: id, Bytes: bytes, Total: total})
+}
+
+func emitVerifyResult(id string, result *dlclib.VerifyResult) {
+	emit(event{Event: "verify_result", ID: id, Verify: result})
+}
+
+func emitError(id string, err error) {
+	emit(event{Event: "error", ID: id, Error: err.Error()})
+}
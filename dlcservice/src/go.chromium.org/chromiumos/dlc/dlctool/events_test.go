@@ -0,0 +1,118 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.chromium.org/chromiumos/dlc/dlclib"
+)
+
+func withJSONOutput(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	prevJSON, prevWriter := jsonOutput, emitWriter
+	buf := &bytes.Buffer{}
+	jsonOutput, emitWriter = true, buf
+	t.Cleanup(func() { jsonOutput, emitWriter = prevJSON, prevWriter })
+	return buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []event {
+	t.Helper()
+
+	var events []event
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("failed to unmarshal event line %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestEmitNoopWithoutJSONOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	prevJSON, prevWriter := jsonOutput, emitWriter
+	jsonOutput, emitWriter = false, buf
+	defer func() { jsonOutput, emitWriter = prevJSON, prevWriter }()
+
+	emitInstallStart("foo")
+	if buf.Len() != 0 {
+		t.Errorf("emit: wrote %q despite jsonOutput being false", buf.String())
+	}
+}
+
+func TestEmitInstallEvents(t *testing.T) {
+	buf := withJSONOutput(t)
+
+	emitInstallStart("foo")
+	emitInstallDone("foo")
+
+	events := decodeLines(t, buf)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if events[0].Event != "install_start" || events[0].ID != "foo" {
+		t.Errorf("events[0] = %+v, want install_start for foo", events[0])
+	}
+	if events[1].Event != "install_done" || events[1].ID != "foo" {
+		t.Errorf("events[1] = %+v, want install_done for foo", events[1])
+	}
+}
+
+func TestEmitExtractProgress(t *testing.T) {
+	buf := withJSONOutput(t)
+
+	emitExtractProgress("foo", 50, 100)
+
+	events := decodeLines(t, buf)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if events[0].Event != "extract_progress" || events[0].Bytes != 50 || events[0].Total != 100 {
+		t.Errorf("events[0] = %+v, want extract_progress 50/100", events[0])
+	}
+}
+
+func TestEmitVerifyResult(t *testing.T) {
+	buf := withJSONOutput(t)
+
+	result := &dlclib.VerifyResult{Missing: []string{"a.txt"}}
+	emitVerifyResult("foo", result)
+
+	events := decodeLines(t, buf)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if events[0].Event != "verify_result" || events[0].Verify == nil {
+		t.Fatalf("events[0] = %+v, want a verify_result with a Verify payload", events[0])
+	}
+	if len(events[0].Verify.Missing) != 1 || events[0].Verify.Missing[0] != "a.txt" {
+		t.Errorf("Verify.Missing = %v, want [a.txt]", events[0].Verify.Missing)
+	}
+}
+
+func TestEmitError(t *testing.T) {
+	buf := withJSONOutput(t)
+
+	emitError("foo", errors.New("boom"))
+
+	events := decodeLines(t, buf)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if events[0].Event != "error" || events[0].Error != "boom" {
+		t.Errorf("events[0] = %+v, want error \"boom\"", events[0])
+	}
+}
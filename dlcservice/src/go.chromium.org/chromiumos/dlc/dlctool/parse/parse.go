@@ -0,0 +1,75 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package parse handles command-line flag parsing for dlctool.
+package parse
+
+import (
+	"flag"
+)
+
+var (
+	// FlagUnpack indicates the DLC image should be unpacked to the given path.
+	FlagUnpack = flag.Bool("unpack", false, "Unpack the DLC image to a directory.")
+
+	// FlagID is the ID of the DLC to operate on.
+	FlagID = flag.String("id", "", "The ID of the DLC.")
+
+	// FlagIDs is a comma-separated list of DLC IDs to operate on in a single
+	// invocation, installed and unpacked concurrently.
+	FlagIDs = flag.String("ids", "", "Comma-separated list of DLC IDs.")
+
+	// FlagOutDir is a comma-separated list of unpack destinations, positionally
+	// paired with FlagIDs.
+	FlagOutDir = flag.String("out-dir", "", "Comma-separated list of unpack destinations, paired with --ids.")
+
+	// FlagMaxParallel caps how many DLCs are installed at once when --ids is used.
+	FlagMaxParallel = flag.Int("max-parallel", 4, "Maximum number of DLCs to install concurrently.")
+
+	// FlagShell forwards the remaining arguments to the dlctool shell helper.
+	FlagShell = flag.Bool("shell", false, "Invoke the dlctool shell variant.")
+
+	// FlagForceFS overrides image-type detection with a named dlclib.Extractor
+	// ("squashfs", "ext4", "erofs").
+	FlagForceFS = flag.String("force-fs", "", "Force a filesystem type instead of detecting it from the image.")
+
+	// FlagRepack rebuilds a DLC image from a directory previously produced by
+	// --unpack and installs it back into the DLC's active slot.
+	FlagRepack = flag.Bool("repack", false, "Rebuild and reinstall a DLC image from an unpacked directory.")
+
+	// FlagDryRun, with --repack, prints the manifest diff instead of writing anything.
+	FlagDryRun = flag.Bool("dry-run", false, "With --repack, print the manifest diff instead of installing.")
+
+	// FlagSignKey, with --repack, re-signs the patched manifest for
+	// developer-mode DLCs whose manifests require a signature.
+	FlagSignKey = flag.String("sign-key", "", "With --repack, path to the key used to re-sign the manifest.")
+
+	// FlagFiles, with --unpack, restricts extraction to a comma-separated
+	// list of paths when the DLC image carries a chunked TOC. Ignored
+	// (the whole image is unpacked) otherwise.
+	FlagFiles = flag.String("files", "", "Comma-separated list of files to extract from a chunked DLC image.")
+
+	// FlagVerify checks an unpacked DLC's files against the per-file digests
+	// in its image's chunked TOC; the manifest's checksums are not used. It's
+	// on by default for scaled and force-ota DLCs even when not passed
+	// explicitly. Images without a chunked TOC fail an explicit --verify and
+	// are skipped by the default one.
+	FlagVerify = flag.Bool("verify", false, "Verify unpacked files against the per-file digests in the DLC image's chunked TOC.")
+
+	// FlagOutput selects dlctool's reporting format. "json" emits
+	// newline-delimited JSON events on stdout and routes human logs to
+	// stderr instead.
+	FlagOutput = flag.String("output", "", `Output format: "json" for newline-delimited JSON events.`)
+)
+
+// Args parses the given arguments under the given program name and returns
+// the single positional argument (the unpack destination path, or with
+// --repack the directory to rebuild the image from).
+func Args(name string, args []string) (string, error) {
+	flag.CommandLine.Init(name, flag.ExitOnError)
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return "", err
+	}
+	return flag.Arg(0), nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"go.chromium.org/chromiumos/dlc/dlclib"
+)
+
+// repackDlc rebuilds id's filesystem image from dir (the output of a prior
+// --unpack), patches its manifest to match, and swaps it into the DLC's
+// active slot. With dryRun it only prints the manifest diff.
+func repackDlc(id, dir *string, dryRun bool, signKey string) error {
+	imagePath := getDlcImagePath(id)
+
+	extractor, err := dlcExtractor(imagePath)
+	if err != nil {
+		return fmt.Errorf("repackDlc: %w", err)
+	}
+	packer, ok := extractor.(dlclib.Packer)
+	if !ok {
+		return fmt.Errorf("repackDlc: %s images can't be repacked", extractor.Name())
+	}
+
+	tmpImage, err := os.CreateTemp("", "dlc-repack-*.img")
+	if err != nil {
+		return fmt.Errorf("repackDlc: failed to create temp image: %w", err)
+	}
+	tmpImage.Close()
+	defer os.Remove(tmpImage.Name())
+
+	if err := packer.Pack(*dir, tmpImage.Name()); err != nil {
+		return fmt.Errorf("repackDlc: failed to build %s image: %w", extractor.Name(), err)
+	}
+
+	manifest, err := dlclib.ReadManifest(id)
+	if err != nil {
+		return fmt.Errorf("repackDlc: %w", err)
+	}
+
+	blocks, err := dlclib.GetFileSizeInBlocks(tmpImage.Name())
+	if err != nil {
+		return fmt.Errorf("repackDlc: failed to size new image: %w", err)
+	}
+	sum, err := dlclib.Sha256Sum(tmpImage.Name())
+	if err != nil {
+		return fmt.Errorf("repackDlc: failed to sum new image: %w", err)
+	}
+
+	newManifest := *manifest
+	newManifest.Size = fmt.Sprintf("%d", blocks)
+	newManifest.ImageSha256Hash = sum
+	// TableSha256Hash covers the filesystem's own index, not the raw image
+	// bytes, and none of the extractors know how to compute that per format
+	// yet, so it's left as whatever the original manifest had rather than
+	// overwritten with a value that's simply wrong.
+
+	if signKey != "" {
+		if err := signManifest(&newManifest, signKey); err != nil {
+			return fmt.Errorf("repackDlc: failed to sign manifest: %w", err)
+		}
+	}
+
+	if dryRun {
+		before, _ := json.MarshalIndent(manifest, "", "  ")
+		after, _ := json.MarshalIndent(newManifest, "", "  ")
+		log.Printf("--repack dry-run for DLC (%s):\nbefore:\n%s\nafter:\n%s\n", *id, before, after)
+		return nil
+	}
+
+	if err := dlclib.CopyFile(tmpImage.Name(), imagePath); err != nil {
+		return fmt.Errorf("repackDlc: failed to install new image: %w", err)
+	}
+	if err := dlclib.WriteManifest(id, &newManifest); err != nil {
+		return fmt.Errorf("repackDlc: failed to patch manifest: %w", err)
+	}
+	if err := reloadDlcservice(); err != nil {
+		return fmt.Errorf("repackDlc: failed to reload dlcservice: %w", err)
+	}
+
+	log.Printf("Repacked DLC (%s) from %s\n", *id, *dir)
+	return nil
+}
+
+// signManifest re-signs m for developer-mode DLCs whose manifests require a
+// signature, storing dlc_sign's output signature on m.
+func signManifest(m *dlclib.Manifest, signKey string) error {
+	cmd := &exec.Cmd{
+		Path: dlcSignToolPath,
+		Args: []string{dlcSignToolPath, "--key=" + signKey, "--manifest-sha256=" + m.ImageSha256Hash},
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("signManifest: %w", err)
+	}
+
+	sig := strings.TrimSpace(string(out))
+	if sig == "" {
+		return fmt.Errorf("signManifest: %s produced an empty signature", dlcSignToolPath)
+	}
+	m.Signature = sig
+	return nil
+}
+
+func reloadDlcservice() error {
+	cmd := &exec.Cmd{
+		Path: dlclib.UtilPath,
+		Args: []string{dlclib.UtilPath, "--reload"},
+	}
+	return cmd.Run()
+}
+
+const dlcSignToolPath = "/usr/bin/dlc_sign"
@@ -0,0 +1,87 @@
+// Copyright 2024 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"go.chromium.org/chromiumos/dlc/dlclib"
+	"go.chromium.org/chromiumos/dlc/dlctool/parse"
+)
+
+// maybeVerifyDlc runs verifyUnpackedDlc when --verify was passed explicitly,
+// or implicitly for scaled/force-ota DLCs, since those are the ones
+// tampering is most likely to matter for.
+//
+// The chunked TOC format Verify relies on is new, and most on-device DLCs
+// don't produce one yet. An explicit --verify still hard-fails against
+// those, but the default-on path for scaled/force-ota DLCs only warns and
+// skips, so --unpack doesn't start failing for every DLC that predates it.
+func maybeVerifyDlc(id *string, unpackDir string) error {
+	explicit := *parse.FlagVerify
+	verify := explicit
+	if !verify {
+		def, err := shouldVerifyByDefault(id)
+		if err != nil {
+			return fmt.Errorf("maybeVerifyDlc: %w", err)
+		}
+		verify = def
+	}
+	if !verify {
+		return nil
+	}
+
+	err := verifyUnpackedDlc(id, getDlcImagePath(id), unpackDir)
+	if !explicit && errors.Is(err, dlclib.ErrNoTOC) {
+		log.Printf("DLC (%s) has no chunked TOC; skipping default verification.\n", *id)
+		return nil
+	}
+	return err
+}
+
+func shouldVerifyByDefault(id *string) (bool, error) {
+	scaled, err := isDlcScaled(id)
+	if err != nil {
+		return false, err
+	}
+	if scaled {
+		return true, nil
+	}
+	return isDlcForceOTA(id)
+}
+
+// verifyUnpackedDlc runs dlclib.Verify for id against unpackDir. On a
+// mismatch it prints the structured diff as JSON to stdout and returns an
+// error, which main turns into a non-zero exit so provisioning pipelines
+// like cros-provision's DLC install command can consume it directly.
+func verifyUnpackedDlc(id *string, imagePath, unpackDir string) error {
+	result, err := dlclib.Verify(id, imagePath, unpackDir)
+	if err != nil {
+		return fmt.Errorf("verifyUnpackedDlc: %w", err)
+	}
+
+	if jsonOutput {
+		emitVerifyResult(*id, result)
+	}
+
+	if result.OK() {
+		log.Printf("DLC (%s) verified OK against its chunked TOC.\n", *id)
+		return nil
+	}
+
+	if !jsonOutput {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("verifyUnpackedDlc: failed to marshal result: %w", err)
+		}
+		fmt.Println(string(b))
+	}
+
+	return fmt.Errorf("verifyUnpackedDlc: DLC (%s) failed verification: %d missing, %d extra, %d corrupt",
+		*id, len(result.Missing), len(result.Extra), len(result.Corrupt))
+}